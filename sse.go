@@ -6,12 +6,31 @@ import (
 	"time"
 
 	"github.com/fatih/color"
+
+	"github.com/404Wolf/live-webapis-demo/sse"
 )
 
+// broker is the one in-process event stream /sse publishes to; every
+// client subscribes to it. A real application would Publish from wherever
+// its events actually originate (a job queue, a chat room, ...); here
+// publishDemoEvents stands in for that.
+var broker = sse.NewBroker()
+
 func StartSSE() {
+	go publishDemoEvents()
 	http.HandleFunc("/sse", sseHandler)
 }
 
+func publishDemoEvents() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for counter := 1; ; counter++ {
+		<-ticker.C
+		broker.Publish("message", fmt.Sprintf("Message #%d from SSE server", counter))
+	}
+}
+
 func sseHandler(w http.ResponseWriter, r *http.Request) {
 	blue := color.New(color.FgBlue)
 
@@ -28,6 +47,11 @@ func sseHandler(w http.ResponseWriter, r *http.Request) {
 	// - SSE: part of the HTML spec
 	// (yes, it's literally part of the HTML spec)
 	// https://html.spec.whatwg.org/multipage/server-sent-events.html
+	//
+	// Part of that spec is a reconnection contract: if the connection
+	// drops, the browser reconnects automatically and sends back whatever
+	// "id:" it last saw as the Last-Event-ID request header, so the
+	// server can resume the stream instead of replaying from the start.
 
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream") // This is where the magic happens
@@ -36,81 +60,40 @@ func sseHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")         // Ensure the connection stays open (important for SSE)
 	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow CORS for testing purposes (so we could serve the HTML from a different origin)
 
-	blue.Println("SSE connection established")
-	blue.Println("---")
-
-	// Send initial connection event
-	blue.Println("Sending SSE message to client:")
-	message := "data: hello from SSE server!\n\n"
-	blue.Printf("Raw SSE message bytes: %v\n", []byte(message))
-	blue.Printf("Message structure:\n")
-	blue.Printf("  Field: data\n")
-	blue.Printf("  Value: hello from SSE server!\n")
-	blue.Printf("  Terminator: \\n\\n (marks end of event)\n")
-	blue.Printf("Message content: %q\n", message)
-	fmt.Fprint(w, message)
-
-	// Here's the fun part! SSE is literally just an open HTTP connection where
-	// the server keeps sending text data formatted in a specific way.
-	//
-	// Do you remember what we usually say to "finish" an HTTP response?
-	//
-	// We send a blank line (i.e., \r\n\r\n) to indicate the end of headers,
-	// and then the body follows. Once the body is sent, at least with HTTP/1.1,
-	// the server typically closes the connection to signal the end of the response.
-
-	// Here, with SSE, we keep the connection open indefinitely!
-	//
-	// Each message is prefixed with "data: " and ends with two newlines.
-	// The client (browser) knows to treat this as a stream of events.
-	//
-	// So we just keep writing to the response writer `w` whenever we want to send
-	// a new event to the client!
-	//
-	// We send a message, followed by two newlines, and then we flush the response
-	// to ensure it gets sent immediately.
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
 
-	if flusher, ok := w.(http.Flusher); ok {
-		flusher.Flush()
+	// retry: tells the browser how long to wait before reconnecting after
+	// a drop, so it backs off instead of hammering us.
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	// Last-Event-ID is normally a request header, but browsers' EventSource
+	// API doesn't let callers set it on the initial connection, so we also
+	// accept it as a query param for clients that want to resume manually.
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
 	}
-	blue.Println("---")
 
-	// Send periodic messages
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+	events := broker.Subscribe(lastEventID)
+	defer broker.Unsubscribe(events)
 
-	counter := 1
-	for range ticker.C {
-		blue.Println("Sending SSE message to client:")
-
-		// Create SSE message with event ID and data
-		eventMessage := fmt.Sprintf("id: %d\ndata: Message #%d from SSE server\n\n", counter, counter)
-
-		blue.Printf("Raw SSE message bytes: %v\n", []byte(eventMessage))
-		blue.Printf("Message structure:\n")
-		blue.Printf("  ID field: %d\n", counter)
-		blue.Printf("  Data field: Message #%d from SSE server\n", counter)
-		blue.Printf("  Terminator: \\n\\n\n")
-		blue.Printf("Full message: %q\n", eventMessage)
-
-		// Show byte breakdown
-		blue.Printf("Byte breakdown:\n")
-		for i, b := range []byte(eventMessage) {
-			if b == '\n' {
-				blue.Printf("  [%d]: \\n (newline, %d, %08b)\n", i, b, b)
-			} else {
-				blue.Printf("  [%d]: %c (%d, %08b)\n", i, b, b, b)
-			}
-		}
+	blue.Println("SSE connection established, resuming from:", lastEventID)
+	blue.Println("---")
 
-		// Send the message
-		fmt.Fprint(w, eventMessage)
-		if flusher, ok := w.(http.Flusher); ok {
+	for {
+		select {
+		case ev := <-events:
+			blue.Printf("Sending SSE message to client: id=%s event=%s\n", ev.ID, ev.Type)
+			fmt.Fprint(w, ev.Format())
 			flusher.Flush()
+		case <-r.Context().Done():
+			blue.Println("SSE client disconnected")
+			return
 		}
-
-		blue.Printf("Sent message #%d\n", counter)
-		blue.Println("---")
-		counter++
 	}
 }
@@ -0,0 +1,118 @@
+// Package sse implements a minimal Server-Sent Events broker: one
+// in-process event stream that many HTTP handlers can publish to, and
+// many subscribers can fan out from, with enough history kept to replay
+// whatever a reconnecting client missed.
+package sse
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// historySize bounds how many recent events the ring buffer keeps for
+// Last-Event-ID replay. Events older than that are simply unrecoverable,
+// same as any fixed-size ring buffer.
+const historySize = 256
+
+// Event is a single server-sent event.
+type Event struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// Format renders e as a complete SSE wire frame, ready to be written to a
+// response body followed by a flush. Per the spec, a multi-line Data must
+// be sent as one "data:" line per line of text, or everything after the
+// first newline is lost.
+func (e Event) Format() string {
+	var b strings.Builder
+	b.WriteString("id: ")
+	b.WriteString(e.ID)
+	b.WriteString("\nevent: ")
+	b.WriteString(e.Type)
+	b.WriteByte('\n')
+	for _, line := range strings.Split(e.Data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// Broker fans published events out to subscribers and replays missed
+// events to those resuming via Last-Event-ID.
+//
+// The zero value is not usable; construct one with NewBroker.
+type Broker struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history []Event
+	subs    map[<-chan Event]chan Event
+}
+
+// NewBroker returns an empty Broker.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[<-chan Event]chan Event)}
+}
+
+// Publish assigns eventType/data the next sequential event ID, records it
+// in the history ring buffer, and delivers it to every current
+// subscriber. A subscriber that isn't keeping up has the event dropped
+// rather than blocking Publish.
+func (b *Broker) Publish(eventType, data string) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev := Event{ID: strconv.FormatUint(b.nextID, 10), Type: eventType, Data: data}
+
+	b.history = append(b.history, ev)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	return ev
+}
+
+// Subscribe registers a new subscriber, returning a channel of events
+// published from now on. If lastID matches an event still held in the
+// history ring buffer, every event after it is replayed on the channel
+// first, per the HTML spec's Last-Event-ID reconnection contract. An
+// unrecognized or empty lastID subscribes with no replay.
+func (b *Broker) Subscribe(lastID string) <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, historySize)
+	b.subs[ch] = ch
+
+	if lastID != "" {
+		for i, ev := range b.history {
+			if ev.ID == lastID {
+				for _, replay := range b.history[i+1:] {
+					ch <- replay
+				}
+				break
+			}
+		}
+	}
+
+	return ch
+}
+
+// Unsubscribe removes a subscriber so Publish stops delivering to it. Call
+// it once the corresponding HTTP handler's client has disconnected.
+func (b *Broker) Unsubscribe(ch <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, ch)
+}
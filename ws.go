@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/fatih/color"
+
+	"github.com/404Wolf/live-webapis-demo/ws"
+	"github.com/404Wolf/live-webapis-demo/wsframe"
 )
 
 func StartWs() {
@@ -84,135 +87,179 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Negotiate permessage-deflate (RFC 7692) if the client offered it.
+	extensionsAccept, pmd, compressed := negotiatePMDeflate(r.Header.Get("Sec-WebSocket-Extensions"))
+
+	// Negotiate a subprotocol from the client's offer list, per RFC 6455
+	// §4.2.2. If none of the client's offers has a registered handler, we
+	// omit Sec-WebSocket-Protocol entirely rather than send an empty one.
+	subprotocol, hasSubprotocol := wsMux.Negotiate(r.Header.Get("Sec-WebSocket-Protocol"))
+
 	// Send handshake response
 	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
 		"Upgrade: websocket\r\n" +
 		"Connection: Upgrade\r\n" +
-		"Sec-WebSocket-Accept: " + acceptKey + "\r\n\r\n"
+		"Sec-WebSocket-Accept: " + acceptKey + "\r\n"
+	if compressed {
+		resp += "Sec-WebSocket-Extensions: " + extensionsAccept + "\r\n"
+	}
+	if hasSubprotocol {
+		resp += "Sec-WebSocket-Protocol: " + subprotocol + "\r\n"
+	}
+	resp += "\r\n"
 
 	bufrw.WriteString(resp)
 	bufrw.Flush()
 	println("WebSocket handshake completed")
 
 	// Handle the connection in a simple loop
-	handleConnection(conn)
+	handleConnection(conn, pmd, subprotocol)
 }
 
-func handleConnection(conn net.Conn) {
+// Keepalive and close-handshake timing, per RFC 6455 §5.5.2-3 and §7.1.1.
+// pongWait is how long we'll wait for any activity from the peer (a PONG,
+// or anything else) before deciding the connection is dead; pingPeriod is
+// comfortably shorter so our PING always beats the deadline.
+const (
+	writeWait     = 10 * time.Second
+	pongWait      = 60 * time.Second
+	pingPeriod    = (pongWait * 9) / 10
+	closeWaitTime = 2 * time.Second
+)
+
+func handleConnection(conn net.Conn, pmd *wsframe.PMDeflate, subprotocol string) {
 	fmt.Println("Starting to handle connection.")
 	yellow := color.New(color.FgYellow)
 	green := color.New(color.FgGreen)
 
-	// Start sending messages in a goroutine
+	reader := wsframe.NewReader(conn)
+	reader.Extension = pmd
+
+	writer := wsframe.NewWriter(conn)
+	writer.Extension = pmd
+	writer.CompressionThreshold = compressionThreshold
+
+	// handler is nil when no subprotocol was negotiated, in which case
+	// this loop falls back to its own plain logging behavior below.
+	var handler ws.Handler
+	if subprotocol != "" {
+		handler = wsMux.New(subprotocol, writer)
+		handler.OnOpen()
+	}
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	// Send periodic PINGs so dead peers get detected even if they never
+	// send us anything. Any message from the peer, including the PONG
+	// this provokes, pushes the read deadline back out in the main loop.
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		ticker := time.NewTicker(time.Second)
+		ticker := time.NewTicker(pingPeriod)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			// Send a simple text frame "hi"
-			frame := []byte{0b1_000_0001, 0b0000_0010, 'h', 'i'} // FIN + text frame, length 2, payload "hi"
-			_, err := conn.Write(frame)
-			if err != nil {
-				green.Printf("Error sending frame: %v\n", err)
+		for {
+			select {
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := writer.WriteMessage(wsframe.OpPing, nil); err != nil {
+					green.Printf("Error sending ping: %v\n", err)
+					return
+				}
+				green.Println("Sent: ping")
+			case <-done:
 				return
 			}
-			green.Println("Sent: hi")
 		}
 	}()
 
-	// Handle incoming messages
+	// Handle incoming messages. wsframe.Reader takes care of fragmentation
+	// reassembly, extended payload lengths, and unmasking, so this loop just
+	// deals in complete application messages.
 	for {
-		// Read frame header (2 bytes minimum)
-		frameHeader := make([]byte, 2)
-		conn.Read(frameHeader) // should do error checking here
-
-		yellow.Println("Received WebSocket frame from client:")
-		yellow.Printf("Frame header bytes: %08b %08b\n", frameHeader[0], frameHeader[1])
-
-		// Parse frame header
-		// the structure of the first byte is:
-		// 1 bit: FIN
-		// 3 bits: RSV1, RSV2, RSV3
-		// 4 bits: Opcode
-		fin := (frameHeader[0] & 0b1_000_0000) != 0 // only keep the FIN bit
-		opcode := frameHeader[0] & 0b0_000_1111     // only keep the opcode bits
-		// the structure of the second byte is:
-		// 1 bit: MASK
-		// 7 bits: Payload length
-		masked := (frameHeader[1] & 0b1_000_0000) != 0 // only keep the MASK bit
-		payloadLen := int(frameHeader[1] & 0b0_111_1111)
-
-		yellow.Printf("FIN: %t, Opcode: %d, Masked: %t, Payload length: %d\n", fin, opcode, masked, payloadLen)
-
-		// Handle extended payload lengths
-		switch payloadLen {
-		case 126:
-			extLen := make([]byte, 2)
-			_, err := conn.Read(extLen)
-			if err != nil {
-				return
+		opcode, payload, err := reader.ReadMessage()
+		if err != nil {
+			yellow.Printf("Connection error: %v\n", err)
+			code := wsframe.CloseProtocolError
+			switch err {
+			case wsframe.ErrInvalidUTF8:
+				code = wsframe.CloseInvalidPayload
+			case wsframe.ErrMessageTooLarge:
+				code = wsframe.CloseMessageTooBig
 			}
-			payloadLen = int(extLen[0])<<8 | int(extLen[1])
-		case 127: // this indicates that the length is in the next 8 bytes (64 bits)
-			extLen := make([]byte, 8)
-			_, err := conn.Read(extLen)
-			if err != nil {
-				return
+			sendClose(writer, code, "")
+			waitForPeerClose(conn)
+			if handler != nil {
+				handler.OnClose(code, "")
 			}
-			// Just take the lower 32 bits for simplicity
-			payloadLen = int(extLen[4])<<24 | int(extLen[5])<<16 | int(extLen[6])<<8 | int(extLen[7])
+			return
 		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
 
-		// Read mask key if present
-		var maskKey []byte
-		if masked {
-			maskKey = make([]byte, 4)
-			_, err := conn.Read(maskKey)
-			if err != nil {
-				return
-			}
-			yellow.Printf("Mask key bytes: %v\n", maskKey)
-		}
+		yellow.Printf("Received message: opcode=%#x, %d bytes\n", opcode, len(payload))
 
-		// Read payload
-		if payloadLen > 0 {
-			payload := make([]byte, payloadLen)
-			_, err := conn.Read(payload)
-			if err != nil {
+		switch opcode {
+		case wsframe.OpPing:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := writer.WriteMessage(wsframe.OpPong, payload); err != nil {
+				yellow.Printf("Error sending pong: %v\n", err)
+				if handler != nil {
+					handler.OnClose(wsframe.CloseInternalErr, "")
+				}
 				return
 			}
-
-			// Unmask if needed
-			if masked {
-				for i := 0; i < len(payload); i++ {
-					payload[i] ^= maskKey[i%4]
-				}
+			yellow.Println("Sent: pong")
+		case wsframe.OpPong:
+			yellow.Println("Received pong")
+		case wsframe.OpClose:
+			code, reason, perr := wsframe.ParseClose(payload)
+			switch {
+			case perr != nil:
+				code = wsframe.CloseProtocolError
+			case !wsframe.ValidUTF8([]byte(reason)):
+				code = wsframe.CloseInvalidPayload
+			case code == 0:
+				code = wsframe.CloseNormal
 			}
-
-			// Handle different opcodes
-			if opcode == 8 { // Close frame
-				yellow.Println("Received close frame - closing connection")
-				// Send close frame back
-				closeFrame := []byte{0x88, 0x00} // FIN + close opcode, no payload
-				conn.Write(closeFrame)
-				return
-			} else if opcode == 1 { // Text frame
+			yellow.Printf("Received close frame: code=%d reason=%q\n", code, reason)
+			sendClose(writer, code, "")
+			waitForPeerClose(conn)
+			if handler != nil {
+				handler.OnClose(code, reason)
+			}
+			return
+		case wsframe.OpText, wsframe.OpBinary:
+			if handler != nil {
+				handler.OnMessage(byte(opcode), payload)
+			} else {
 				yellow.Printf("Received message: %s\n", string(payload))
 			}
 		}
 
-		// If it's a close frame with no payload
-		if opcode == 8 && payloadLen == 0 {
-			yellow.Println("Received close frame - closing connection")
-			// Send close frame back
-			closeFrame := []byte{
-				0b1_000_1000, // FIN + close opcode, no payload
-				0b0_000_0000, // no mask, length 0
-			}
-			conn.Write(closeFrame)
+		yellow.Println("---")
+	}
+}
+
+// sendClose writes a close frame carrying code and reason, falling back to
+// 1011 (internal error) if the reason doesn't fit in the control frame's
+// 125-byte payload limit.
+func sendClose(writer *wsframe.Writer, code uint16, reason string) {
+	payload, err := wsframe.EncodeClose(code, reason)
+	if err != nil {
+		payload, _ = wsframe.EncodeClose(wsframe.CloseInternalErr, "")
+	}
+	writer.WriteMessage(wsframe.OpClose, payload)
+}
+
+// waitForPeerClose waits briefly for the peer to close its side of the TCP
+// connection after we've sent our close frame, per RFC 6455 §7.1.1, before
+// the caller hard-closes it regardless.
+func waitForPeerClose(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(closeWaitTime))
+	buf := make([]byte, 256)
+	for {
+		if _, err := conn.Read(buf); err != nil {
 			return
 		}
-
-		yellow.Println("---")
 	}
 }
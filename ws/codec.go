@@ -0,0 +1,27 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"github.com/404Wolf/live-webapis-demo/wsframe"
+)
+
+// JSONCodec marshals/unmarshals Go values as WebSocket text frames,
+// mirroring the historical golang.org/x/net/websocket websocket.JSON
+// codec's Send/Receive API.
+type JSONCodec struct{}
+
+// Send marshals v as JSON and writes it as a single text message.
+func (JSONCodec) Send(w *wsframe.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.WriteMessage(wsframe.OpText, data)
+}
+
+// Receive unmarshals a text frame's payload, as delivered to
+// Handler.OnMessage, into v.
+func (JSONCodec) Receive(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
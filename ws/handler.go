@@ -0,0 +1,72 @@
+// Package ws provides a small per-subprotocol dispatch layer on top of
+// wsframe: a Handler interface for reacting to one connection's lifecycle,
+// a Mux for negotiating and registering handlers by subprotocol, and a
+// JSONCodec for struct-based messaging over text frames.
+package ws
+
+import (
+	"strings"
+
+	"github.com/404Wolf/live-webapis-demo/wsframe"
+)
+
+// Handler reacts to the lifecycle of one WebSocket connection running a
+// particular negotiated subprotocol.
+type Handler interface {
+	// OnOpen is called once the connection is established.
+	OnOpen()
+	// OnMessage is called for each complete data message (op is an
+	// wsframe.OpText/OpBinary opcode).
+	OnMessage(op byte, data []byte)
+	// OnClose is called once, when the connection is closing.
+	OnClose(code uint16, reason string)
+}
+
+// HandlerFactory constructs a Handler for a single connection, given the
+// Writer it should use to reply on.
+type HandlerFactory func(w *wsframe.Writer) Handler
+
+// Mux negotiates a subprotocol from a client's offer list and constructs
+// the Handler registered for it, so multiple subprotocols (e.g. "chat.v1"
+// and "echo") can coexist on the same endpoint.
+//
+// The zero value is not usable; construct one with NewMux.
+type Mux struct {
+	factories map[string]HandlerFactory
+}
+
+// NewMux returns an empty Mux.
+func NewMux() *Mux {
+	return &Mux{factories: make(map[string]HandlerFactory)}
+}
+
+// Register associates subprotocol with factory. A later call with the
+// same subprotocol replaces the previous registration.
+func (m *Mux) Register(subprotocol string, factory HandlerFactory) {
+	m.factories[subprotocol] = factory
+}
+
+// Negotiate parses a comma-separated Sec-WebSocket-Protocol request header
+// value and returns the first subprotocol, in the client's preferred
+// order, that has a registered Handler. ok is false if none match, in
+// which case RFC 6455 §4.2.2 requires the server to omit the response
+// header entirely rather than send an empty one.
+func (m *Mux) Negotiate(header string) (subprotocol string, ok bool) {
+	for _, offer := range strings.Split(header, ",") {
+		name := strings.TrimSpace(offer)
+		if _, ok := m.factories[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// New constructs the Handler registered for subprotocol, or nil if none is
+// registered.
+func (m *Mux) New(subprotocol string, w *wsframe.Writer) Handler {
+	factory, ok := m.factories[subprotocol]
+	if !ok {
+		return nil
+	}
+	return factory(w)
+}
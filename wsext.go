@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/404Wolf/live-webapis-demo/wsframe"
+)
+
+// compressionThreshold is the minimum payload size, in bytes, worth
+// compressing; see wsframe.Writer.CompressionThreshold.
+const compressionThreshold = 256
+
+// negotiatePMDeflate parses a Sec-WebSocket-Extensions request header and,
+// if the client offered permessage-deflate (RFC 7692), builds the
+// connection's PMDeflate state plus the extension-list value to echo back
+// in the 101 response. ok is false if the client didn't offer
+// permessage-deflate, in which case the connection proceeds uncompressed.
+func negotiatePMDeflate(header string) (accept string, pmd *wsframe.PMDeflate, ok bool) {
+	if header == "" {
+		return "", nil, false
+	}
+
+	for _, offer := range strings.Split(header, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+
+		pmd = &wsframe.PMDeflate{}
+		accepted := []string{"permessage-deflate"}
+		for _, raw := range params[1:] {
+			param := strings.TrimSpace(raw)
+			switch {
+			case param == "server_no_context_takeover":
+				pmd.ServerNoContextTakeover = true
+				accepted = append(accepted, param)
+			case param == "client_no_context_takeover":
+				pmd.ClientNoContextTakeover = true
+				accepted = append(accepted, param)
+			case strings.HasPrefix(param, "client_max_window_bits"):
+				// compress/flate always decodes with the full 32K window,
+				// which satisfies any client_max_window_bits the client
+				// asks for, so we can just echo this back unchanged.
+				accepted = append(accepted, param)
+			case strings.HasPrefix(param, "server_max_window_bits"):
+				// compress/flate can't actually restrict our own encoder's
+				// window, so we can't honor a server_max_window_bits below
+				// the full 15 bits. Drop it from the accepted response
+				// rather than lie about a constraint we don't enforce;
+				// the client's decoder window only needs to be >= ours,
+				// and omitting the parameter means "no restriction" (15).
+			}
+		}
+		return strings.Join(accepted, "; "), pmd, true
+	}
+
+	return "", nil, false
+}
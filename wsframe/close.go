@@ -0,0 +1,52 @@
+package wsframe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Close status codes defined by RFC 6455 §7.4.1 that callers in this repo
+// actually use. There are many more defined by the RFC and the IANA
+// registry; add them here as they're needed.
+const (
+	CloseNormal         uint16 = 1000
+	CloseProtocolError  uint16 = 1002
+	CloseInvalidPayload uint16 = 1007
+	CloseMessageTooBig  uint16 = 1009
+	CloseInternalErr    uint16 = 1011
+)
+
+// ErrCloseReasonTooLong is returned by EncodeClose when the status code
+// plus reason wouldn't fit in a control frame's 125-byte payload limit.
+var ErrCloseReasonTooLong = errors.New("wsframe: close reason too long to fit alongside the status code")
+
+// ErrInvalidClosePayload is returned by ParseClose for a close frame
+// payload of exactly 1 byte, which §7.4 forbids (a status code, if
+// present at all, must be the full 2 bytes).
+var ErrInvalidClosePayload = errors.New("wsframe: close frame payload must be 0 bytes or at least 2")
+
+// EncodeClose builds the payload of a close frame: a 2-byte big-endian
+// status code per §7.4, followed by an optional UTF-8 reason string.
+func EncodeClose(code uint16, reason string) ([]byte, error) {
+	if 2+len(reason) > 125 {
+		return nil, ErrCloseReasonTooLong
+	}
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	copy(payload[2:], reason)
+	return payload, nil
+}
+
+// ParseClose splits a close frame payload into its status code and reason.
+// A zero-length payload is valid per §7.1.5 and means the peer gave no
+// status code.
+func ParseClose(payload []byte) (code uint16, reason string, err error) {
+	switch len(payload) {
+	case 0:
+		return 0, "", nil
+	case 1:
+		return 0, "", ErrInvalidClosePayload
+	default:
+		return binary.BigEndian.Uint16(payload[:2]), string(payload[2:]), nil
+	}
+}
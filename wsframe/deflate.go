@@ -0,0 +1,97 @@
+package wsframe
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+)
+
+// deflateWindow is the maximum LZ77 sliding window compress/flate uses; we
+// keep this much trailing decompressed output around as a dictionary to
+// approximate context takeover between messages.
+const deflateWindow = 32768
+
+// pmdeflateTrailer is the 4-byte marker RFC 7692 §7.2.1 says to append
+// before inflating a permessage-deflate payload (compress/flate streams
+// don't otherwise signal their own end; a synced flate.Writer.Flush
+// produces exactly this marker, which senders strip before framing).
+var pmdeflateTrailer = []byte{0x00, 0x00, 0xff, 0xff}
+
+// flateFinalBlock is an empty final stored block. compress/flate reports
+// io.ErrUnexpectedEOF for a stream that ends without a final block, so
+// Inflate appends this after pmdeflateTrailer.
+var flateFinalBlock = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+// PMDeflate holds the permessage-deflate (RFC 7692) state negotiated for
+// one WebSocket connection. A Reader and Writer on the same connection
+// should share a single PMDeflate so compression context carries across
+// messages in each direction as negotiated.
+type PMDeflate struct {
+	// ServerNoContextTakeover/ClientNoContextTakeover mirror the
+	// negotiated extension parameters: when set, the corresponding
+	// direction resets its compression context after every message
+	// instead of carrying it over to the next.
+	ServerNoContextTakeover bool
+	ClientNoContextTakeover bool
+
+	inflateDict []byte
+	flateBuf    bytes.Buffer
+	flateWriter *flate.Writer
+}
+
+// Inflate decompresses a reassembled message payload that had RSV1 set on
+// its first frame.
+func (d *PMDeflate) Inflate(payload []byte) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(payload), bytes.NewReader(pmdeflateTrailer), bytes.NewReader(flateFinalBlock))
+	r := flate.NewReaderDict(src, d.inflateDict)
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ClientNoContextTakeover {
+		d.inflateDict = nil
+	} else {
+		d.inflateDict = slidingWindow(append(d.inflateDict, out...))
+	}
+	return out, nil
+}
+
+// Deflate compresses a message payload for sending with RSV1 set. The
+// trailing 4-byte marker a synced flate.Writer produces is stripped, per
+// §7.2.1, since the receiver re-appends it before inflating.
+func (d *PMDeflate) Deflate(payload []byte) ([]byte, error) {
+	if d.flateWriter == nil {
+		w, err := flate.NewWriter(&d.flateBuf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		d.flateWriter = w
+	}
+
+	d.flateBuf.Reset()
+	if _, err := d.flateWriter.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := d.flateWriter.Flush(); err != nil {
+		return nil, err
+	}
+
+	if d.ServerNoContextTakeover {
+		// Reset rather than Close: Close would append a final block after
+		// the marker, and the marker would then not be stripped below.
+		d.flateWriter.Reset(&d.flateBuf)
+	}
+
+	return bytes.TrimSuffix(d.flateBuf.Bytes(), pmdeflateTrailer), nil
+}
+
+// slidingWindow trims buf to at most the last deflateWindow bytes.
+func slidingWindow(buf []byte) []byte {
+	if len(buf) <= deflateWindow {
+		return buf
+	}
+	return append([]byte(nil), buf[len(buf)-deflateWindow:]...)
+}
@@ -0,0 +1,349 @@
+// Package wsframe implements the RFC 6455 WebSocket framing layer: parsing
+// and serializing individual frames, and reassembling fragmented messages
+// into complete application messages.
+//
+// It intentionally knows nothing about the HTTP upgrade handshake or any
+// particular server loop — it just turns an io.Reader/io.Writer pair (the
+// hijacked TCP connection) into ReadMessage/WriteMessage.
+package wsframe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Opcode identifies the type of a WebSocket frame, per RFC 6455 §5.2.
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xA
+)
+
+// IsControl reports whether op is a control opcode (0x8-0xF). Control
+// frames may never be fragmented and are capped at 125 bytes of payload.
+func (op Opcode) IsControl() bool {
+	return op&0x08 != 0
+}
+
+// maxFramePayload bounds the 64-bit extended length form so a malicious or
+// broken peer can't make us allocate an enormous buffer from a single
+// header.
+const maxFramePayload = 1 << 30 // 1 GiB
+
+var (
+	ErrReservedBitSet         = errors.New("wsframe: RSV bit set without a negotiated extension")
+	ErrNonMinimalLength       = errors.New("wsframe: payload length not minimally encoded")
+	ErrFrameTooLarge          = errors.New("wsframe: frame payload exceeds maximum size")
+	ErrControlTooLarge        = errors.New("wsframe: control frame payload exceeds 125 bytes")
+	ErrControlFragmented      = errors.New("wsframe: control frames must not be fragmented")
+	ErrUnexpectedContinuation = errors.New("wsframe: continuation frame received outside a fragmented message")
+	ErrExpectedContinuation   = errors.New("wsframe: new data frame received while a fragmented message is in progress")
+	ErrMessageTooLarge        = errors.New("wsframe: reassembled message exceeds maximum size")
+)
+
+// Frame is a single raw frame as it appears on the wire, before any
+// fragmentation reassembly.
+type Frame struct {
+	Fin              bool
+	RSV1, RSV2, RSV3 bool
+	Opcode           Opcode
+	Masked           bool
+	Payload          []byte
+}
+
+// Reader reads RFC 6455 frames from the underlying connection and
+// reassembles fragmented messages.
+//
+// The zero value is not usable; construct one with NewReader.
+type Reader struct {
+	r io.Reader
+
+	// Extension, if non-nil, is the permessage-deflate (RFC 7692) state
+	// negotiated for this connection. When set, RSV1 is permitted on
+	// frames and a message with RSV1 set on its first frame is inflated
+	// before being returned from ReadMessage.
+	Extension *PMDeflate
+
+	fragmenting bool
+	fragOpcode  Opcode
+	fragRSV1    bool
+	fragBuf     []byte
+	fragUTF8    UTF8Validator
+}
+
+// NewReader returns a Reader that reads frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// ReadFrame reads and validates a single raw frame off the wire. It does
+// not reassemble fragmented messages; most callers want ReadMessage
+// instead. ReadFrame uses io.ReadFull throughout so a short read from the
+// underlying connection returns an error rather than silently desyncing
+// the frame stream.
+func (fr *Reader) ReadFrame() (Frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(fr.r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	f := Frame{
+		Fin:    header[0]&0x80 != 0,
+		RSV1:   header[0]&0x40 != 0,
+		RSV2:   header[0]&0x20 != 0,
+		RSV3:   header[0]&0x10 != 0,
+		Opcode: Opcode(header[0] & 0x0f),
+		Masked: header[1]&0x80 != 0,
+	}
+
+	if f.RSV2 || f.RSV3 || (f.RSV1 && fr.Extension == nil) {
+		return Frame{}, ErrReservedBitSet
+	}
+
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		// RFC 6455 §5.2: the 16-bit form MUST NOT be used to encode a
+		// length that would fit in the base 7 bits (i.e. < 126).
+		var ext [2]byte
+		if _, err := io.ReadFull(fr.r, ext[:]); err != nil {
+			return Frame{}, err
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+		if length < 126 {
+			return Frame{}, ErrNonMinimalLength
+		}
+	case 127:
+		// The 64-bit form MUST NOT be used to encode a length that would
+		// fit in the 16-bit form (i.e. <= 0xffff).
+		var ext [8]byte
+		if _, err := io.ReadFull(fr.r, ext[:]); err != nil {
+			return Frame{}, err
+		}
+		length64 := binary.BigEndian.Uint64(ext[:])
+		if length64 <= 0xffff {
+			return Frame{}, ErrNonMinimalLength
+		}
+		if length64 > maxFramePayload {
+			return Frame{}, ErrFrameTooLarge
+		}
+		length = int(length64)
+	}
+
+	if f.Opcode.IsControl() {
+		if !f.Fin {
+			return Frame{}, ErrControlFragmented
+		}
+		if length > 125 {
+			return Frame{}, ErrControlTooLarge
+		}
+	}
+
+	var maskKey [4]byte
+	if f.Masked {
+		if _, err := io.ReadFull(fr.r, maskKey[:]); err != nil {
+			return Frame{}, err
+		}
+	}
+
+	if length > 0 {
+		f.Payload = make([]byte, length)
+		if _, err := io.ReadFull(fr.r, f.Payload); err != nil {
+			return Frame{}, err
+		}
+		if f.Masked {
+			for i := range f.Payload {
+				f.Payload[i] ^= maskKey[i%4]
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// ReadMessage reads frames until a complete application message has been
+// assembled, buffering OpContinuation frames per RFC 6455 §5.4 until one
+// arrives with FIN=1. Control frames (ping/pong/close) are never
+// fragmented, so they're returned as soon as they arrive, even if a data
+// message is mid-fragmentation.
+func (fr *Reader) ReadMessage() (Opcode, []byte, error) {
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if f.Opcode.IsControl() {
+			return f.Opcode, f.Payload, nil
+		}
+
+		switch f.Opcode {
+		case OpContinuation:
+			if !fr.fragmenting {
+				return 0, nil, ErrUnexpectedContinuation
+			}
+			if len(fr.fragBuf)+len(f.Payload) > maxFramePayload {
+				return 0, nil, ErrMessageTooLarge
+			}
+			fr.fragBuf = append(fr.fragBuf, f.Payload...)
+			// Uncompressed text is validated incrementally, per fragment,
+			// as it arrives; a compressed message can only be validated
+			// once fully inflated below, at FIN.
+			if fr.fragOpcode == OpText && !fr.fragRSV1 && !fr.fragUTF8.Write(f.Payload) {
+				return 0, nil, ErrInvalidUTF8
+			}
+		case OpText, OpBinary:
+			if fr.fragmenting {
+				return 0, nil, ErrExpectedContinuation
+			}
+			if len(f.Payload) > maxFramePayload {
+				return 0, nil, ErrMessageTooLarge
+			}
+			fr.fragOpcode = f.Opcode
+			fr.fragRSV1 = f.RSV1
+			fr.fragBuf = append([]byte(nil), f.Payload...)
+			fr.fragmenting = true
+			fr.fragUTF8 = UTF8Validator{}
+			if f.Opcode == OpText && !f.RSV1 && !fr.fragUTF8.Write(f.Payload) {
+				return 0, nil, ErrInvalidUTF8
+			}
+		default:
+			return 0, nil, fmt.Errorf("wsframe: unsupported opcode %#x", f.Opcode)
+		}
+
+		if f.Fin {
+			opcode, payload, rsv1 := fr.fragOpcode, fr.fragBuf, fr.fragRSV1
+			fr.fragmenting, fr.fragBuf = false, nil
+
+			if rsv1 {
+				if fr.Extension == nil {
+					return 0, nil, ErrReservedBitSet
+				}
+				decompressed, err := fr.Extension.Inflate(payload)
+				if err != nil {
+					return 0, nil, err
+				}
+				payload = decompressed
+				if opcode == OpText && !ValidUTF8(payload) {
+					return 0, nil, ErrInvalidUTF8
+				}
+			} else if opcode == OpText && !fr.fragUTF8.Complete() {
+				return 0, nil, ErrInvalidUTF8
+			}
+
+			return opcode, payload, nil
+		}
+	}
+}
+
+// Writer writes RFC 6455 frames to the underlying connection. Per §5.1, a
+// server must never mask frames it sends, so Writer never does.
+//
+// The zero value is not usable; construct one with NewWriter.
+type Writer struct {
+	w io.Writer
+
+	// mu serializes WriteFrame/WriteMessage calls: a frame's header and
+	// payload go out as two separate Write calls, and without this a
+	// ping or pong written from another goroutine (see handleConnection's
+	// keepalive ticker) could land its bytes in between them and corrupt
+	// the frame stream. It also covers the Extension.Deflate call in
+	// WriteMessage, since PMDeflate's compression state isn't safe for
+	// concurrent use on its own.
+	mu sync.Mutex
+
+	// Extension, if non-nil, is the permessage-deflate (RFC 7692) state
+	// negotiated for this connection. WriteMessage compresses data frame
+	// payloads through it and sets RSV1 accordingly.
+	Extension *PMDeflate
+
+	// CompressionThreshold is the minimum payload size, in bytes, that
+	// WriteMessage will bother compressing. Below it, RSV1 is left unset
+	// and the payload is sent as-is, since deflating a tiny payload tends
+	// to grow it once frame overhead is counted.
+	CompressionThreshold int
+}
+
+// NewWriter returns a Writer that writes frames to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteFrame writes a single raw, uncompressed frame with the given FIN
+// bit and opcode. Callers that want permessage-deflate applied should use
+// WriteMessage instead.
+func (fw *Writer) WriteFrame(fin bool, opcode Opcode, payload []byte) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.writeFrame(fin, opcode, payload, false)
+}
+
+// writeFrame does the actual encoding and write; callers must hold fw.mu.
+func (fw *Writer) writeFrame(fin bool, opcode Opcode, payload []byte, rsv1 bool) error {
+	if opcode.IsControl() {
+		if !fin {
+			return ErrControlFragmented
+		}
+		if len(payload) > 125 {
+			return ErrControlTooLarge
+		}
+	}
+
+	header := make([]byte, 2, 10)
+	if fin {
+		header[0] = 0x80
+	}
+	if rsv1 {
+		header[0] |= 0x40
+	}
+	header[0] |= byte(opcode)
+
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:4], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:10], uint64(n))
+	}
+
+	if _, err := fw.w.Write(header); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := fw.w.Write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMessage writes payload as a single, unfragmented message. Data
+// frames (text/binary) are compressed through Extension, with RSV1 set,
+// when Extension is configured and payload meets CompressionThreshold;
+// control frames are never compressed.
+func (fw *Writer) WriteMessage(opcode Opcode, payload []byte) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.Extension != nil && !opcode.IsControl() && len(payload) >= fw.CompressionThreshold {
+		compressed, err := fw.Extension.Deflate(payload)
+		if err != nil {
+			return err
+		}
+		return fw.writeFrame(true, opcode, compressed, true)
+	}
+	return fw.writeFrame(true, opcode, payload, false)
+}
@@ -0,0 +1,83 @@
+package wsframe
+
+import "errors"
+
+// ErrInvalidUTF8 is returned by Reader.ReadMessage when a text message's
+// payload is not valid UTF-8, per RFC 6455 §8.1. A connection that hits
+// this error must be failed with close code 1007. Close frame reasons are
+// not checked by ReadMessage; callers check them with ValidUTF8.
+var ErrInvalidUTF8 = errors.New("wsframe: invalid UTF-8")
+
+// utf8Accept and utf8Reject are the DFA states meaning "the bytes fed so
+// far form complete, valid UTF-8" and "invalid", per Björn Höhrmann's
+// UTF-8 decoder (https://bjoern.hoehrmann.de/utf-8/decoder/dfa/, MIT
+// licensed). Any other state means valid so far, but midway through a
+// multi-byte code point.
+const (
+	utf8Accept = 0
+	utf8Reject = 12
+)
+
+// utf8DFA is Höhrmann's combined table: the first 256 entries map each
+// possible input byte to one of 12 character classes; the remaining 108
+// entries are indexed by state+class to produce the next state, i.e.
+// state = utf8DFA[256+state+utf8DFA[b]].
+var utf8DFA = [256 + 108]byte{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	8, 8, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	10, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 4, 3, 3, 11, 6, 6, 6, 5, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+
+	0, 12, 24, 36, 60, 96, 84, 12, 12, 12, 48, 72,
+	12, 12, 12, 12, 12, 12, 12, 12, 12, 12, 12, 12,
+	12, 0, 12, 12, 12, 12, 12, 0, 12, 0, 12, 12,
+	12, 24, 12, 12, 12, 12, 12, 24, 12, 24, 12, 12,
+	12, 12, 12, 12, 12, 12, 12, 24, 12, 12, 12, 12,
+	12, 24, 12, 12, 12, 12, 12, 12, 12, 24, 12, 12,
+	12, 12, 12, 12, 12, 12, 12, 36, 12, 36, 12, 12,
+	12, 36, 12, 12, 12, 12, 12, 36, 12, 36, 12, 12,
+	12, 36, 12, 12, 12, 12, 12, 12, 12, 12, 12, 12,
+}
+
+// UTF8Validator is a streaming UTF-8 validator suitable for a message
+// split across multiple frames: feed it each fragment's payload as it
+// arrives, in order, and a multi-byte code point split across a fragment
+// boundary is still validated correctly, since the DFA's state carries
+// over between Write calls.
+//
+// The zero value is a validator in the initial (accept) state.
+type UTF8Validator struct {
+	state byte
+}
+
+// Write feeds more bytes into the validator. It returns false as soon as
+// an invalid byte sequence is seen, at which point the connection should
+// be failed; the validator must not be written to again afterward.
+func (v *UTF8Validator) Write(p []byte) bool {
+	for _, b := range p {
+		v.state = utf8DFA[256+int(v.state)+int(utf8DFA[b])]
+		if v.state == utf8Reject {
+			return false
+		}
+	}
+	return true
+}
+
+// Complete reports whether the bytes fed so far form complete, valid
+// UTF-8 with no code point left unfinished — i.e. it's safe to stop here,
+// such as at a message's FIN frame.
+func (v *UTF8Validator) Complete() bool {
+	return v.state == utf8Accept
+}
+
+// ValidUTF8 reports whether p is complete, valid UTF-8. It's a
+// convenience wrapper around UTF8Validator for callers checking a whole
+// buffer at once, such as a close frame's reason string.
+func ValidUTF8(p []byte) bool {
+	var v UTF8Validator
+	return v.Write(p) && v.Complete()
+}
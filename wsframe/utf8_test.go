@@ -0,0 +1,45 @@
+package wsframe
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzUTF8Validator(f *testing.F) {
+	f.Add([]byte("hello, world"))
+	f.Add([]byte{0xff, 0xfe, 0xfd})
+	f.Add([]byte("wörld ☃ 🎉"))
+	f.Add([]byte{0xe2, 0x82}) // truncated multi-byte sequence
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var v UTF8Validator
+		got := v.Write(b) && v.Complete()
+		want := utf8.Valid(b)
+		if got != want {
+			t.Fatalf("UTF8Validator disagreed with utf8.Valid for %x: got %v, want %v", b, got, want)
+		}
+	})
+}
+
+// TestUTF8ValidatorStreaming checks that feeding a message one byte at a
+// time, as continuation frames would, gives the same verdict as
+// validating it all at once — the whole point of carrying state across
+// Write calls.
+func TestUTF8ValidatorStreaming(t *testing.T) {
+	msg := []byte("hello, 世界 🌍")
+
+	var whole UTF8Validator
+	if !whole.Write(msg) || !whole.Complete() {
+		t.Fatalf("expected %q to be valid UTF-8", msg)
+	}
+
+	var streamed UTF8Validator
+	for _, b := range msg {
+		if !streamed.Write([]byte{b}) {
+			t.Fatalf("streamed validator rejected %q one byte at a time", msg)
+		}
+	}
+	if !streamed.Complete() {
+		t.Fatalf("streamed validator did not reach accept state for %q", msg)
+	}
+}
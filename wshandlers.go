@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/404Wolf/live-webapis-demo/ws"
+	"github.com/404Wolf/live-webapis-demo/wsframe"
+)
+
+// wsMux negotiates and dispatches the /ws endpoint's subprotocols. Each
+// handler below is a small demo of what a real one would do.
+var wsMux = ws.NewMux()
+
+func init() {
+	wsMux.Register("chat.v1", newChatHandler)
+	wsMux.Register("echo", newEchoHandler)
+}
+
+var jsonCodec ws.JSONCodec
+
+// chatMessage is the "chat.v1" wire format.
+type chatMessage struct {
+	User string `json:"user"`
+	Text string `json:"text"`
+}
+
+// chatHandler implements ws.Handler for "chat.v1": it echoes every
+// message it receives back to the same connection.
+type chatHandler struct {
+	writer *wsframe.Writer
+}
+
+func newChatHandler(w *wsframe.Writer) ws.Handler {
+	return &chatHandler{writer: w}
+}
+
+func (h *chatHandler) OnOpen() {
+	fmt.Println("chat.v1: connection opened")
+}
+
+func (h *chatHandler) OnMessage(op byte, data []byte) {
+	var msg chatMessage
+	if err := jsonCodec.Receive(data, &msg); err != nil {
+		fmt.Printf("chat.v1: invalid message: %v\n", err)
+		return
+	}
+	fmt.Printf("chat.v1: %s: %s\n", msg.User, msg.Text)
+	if err := jsonCodec.Send(h.writer, msg); err != nil {
+		fmt.Printf("chat.v1: error replying: %v\n", err)
+	}
+}
+
+func (h *chatHandler) OnClose(code uint16, reason string) {
+	fmt.Printf("chat.v1: closed: code=%d reason=%q\n", code, reason)
+}
+
+// echoHandler implements ws.Handler for "echo": it writes back whatever it
+// receives, unchanged.
+type echoHandler struct {
+	writer *wsframe.Writer
+}
+
+func newEchoHandler(w *wsframe.Writer) ws.Handler {
+	return &echoHandler{writer: w}
+}
+
+func (h *echoHandler) OnOpen() {
+	fmt.Println("echo: connection opened")
+}
+
+func (h *echoHandler) OnMessage(op byte, data []byte) {
+	if err := h.writer.WriteMessage(wsframe.Opcode(op), data); err != nil {
+		fmt.Printf("echo: error replying: %v\n", err)
+	}
+}
+
+func (h *echoHandler) OnClose(code uint16, reason string) {
+	fmt.Printf("echo: closed: code=%d reason=%q\n", code, reason)
+}